@@ -8,26 +8,157 @@ package sqlbuilder
 
 import (
 	"bytes"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
-	"time"
 
 	"github.com/youtube/vitess/go/sqltypes"
 )
 
+// StrVal is a quoted textual literal (CHAR, VARCHAR, TEXT and similar).
+type StrVal []byte
+
+// BytesVal is a quoted binary literal (BINARY, VARBINARY, BLOB and similar).
+type BytesVal []byte
+
+// NumVal is an unquoted numeric literal (integer or floating point), safe to
+// emit verbatim.
+type NumVal []byte
+
+// EncodedVal is a literal whose bytes have already been dialect-encoded (for
+// example by sqltypes.Value.EncodeSql) and must not be re-escaped.
+type EncodedVal []byte
+
+// RawVal is emitted verbatim with no quoting or escaping at all, e.g. NULL
+// or a previously-serialized SQL fragment.
+type RawVal []byte
+
+// Writer is the sink that Expression/Clause nodes serialize into. It lets
+// the same AST be rendered two different ways: standardWriter inlines
+// encoded literals directly into the SQL text (the historical behavior,
+// good for logging), while placeholderWriter emits a driver placeholder for
+// every non-NULL literal and collects the corresponding values, so the text
+// is safe to hand to database/sql and its prepared statement cache. NULL is
+// written inline as raw text by both.
+type Writer interface {
+	io.Writer
+	WriteStr(StrVal)
+	WriteBytes(BytesVal)
+	WriteNum(NumVal)
+	WriteEncoded(EncodedVal)
+	WriteRaw(RawVal)
+}
+
+// standardWriter renders literals inline, escaped into the SQL text itself.
+type standardWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *standardWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// writeQuoted re-encodes v the same way sqltypes.Value.EncodeSql always
+// has, rather than reimplementing quoting by hand: building a Value and
+// delegating to EncodeSql keeps this byte-for-byte consistent with vitess's
+// escaper (which, unlike a naive quote/backslash escaper, also escapes NUL,
+// newline, CR and \x1a) instead of drifting from it.
+func (w *standardWriter) writeQuoted(v []byte, isBytes bool) {
+	var (
+		value sqltypes.Value
+		err   error
+	)
+	if isBytes {
+		value, err = sqltypes.BuildValue(v)
+	} else {
+		value, err = sqltypes.BuildValue(string(v))
+	}
+	if err != nil {
+		// v was already carved out of a literalExpression's own Value, so
+		// re-building it here cannot fail without a bug elsewhere.
+		panic("sqlbuilder: re-encoding literal failed: " + err.Error())
+	}
+	value.EncodeSql(&w.buf)
+}
+
+func (w *standardWriter) WriteStr(v StrVal)         { w.writeQuoted(v, false) }
+func (w *standardWriter) WriteBytes(v BytesVal)     { w.writeQuoted(v, true) }
+func (w *standardWriter) WriteNum(v NumVal)         { w.buf.Write(v) }
+func (w *standardWriter) WriteEncoded(v EncodedVal) { w.buf.Write(v) }
+func (w *standardWriter) WriteRaw(v RawVal)         { w.buf.Write(v) }
+
+func (w *standardWriter) String() string { return w.buf.String() }
+
+// numberedPlaceholderDialect is implemented by dialects (e.g. Postgres) whose
+// placeholders are numbered ($1, $2, ...) rather than the MySQL-style "?".
+type numberedPlaceholderDialect interface {
+	Dialect
+	NumberedPlaceholders() bool
+}
+
+// placeholderWriter renders literals as driver placeholders and accumulates
+// the bound values in args, in placeholder order, so the returned SQL text
+// and args slice can be passed straight to database/sql.
+type placeholderWriter struct {
+	buf     bytes.Buffer
+	args    []driver.Value
+	dialect Dialect
+}
+
+func (w *placeholderWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *placeholderWriter) writePlaceholder(raw []byte) {
+	if d, ok := w.dialect.(numberedPlaceholderDialect); ok && d.NumberedPlaceholders() {
+		fmt.Fprintf(&w.buf, "$%d", len(w.args)+1)
+	} else {
+		w.buf.WriteByte('?')
+	}
+	w.args = append(w.args, append([]byte(nil), raw...))
+}
+
+func (w *placeholderWriter) WriteStr(v StrVal)         { w.writePlaceholder(v) }
+func (w *placeholderWriter) WriteBytes(v BytesVal)     { w.writePlaceholder(v) }
+func (w *placeholderWriter) WriteNum(v NumVal)         { w.writePlaceholder(v) }
+func (w *placeholderWriter) WriteEncoded(v EncodedVal) { w.writePlaceholder(v) }
+func (w *placeholderWriter) WriteRaw(v RawVal)         { w.buf.Write(v) }
+
+func (w *placeholderWriter) String() string { return w.buf.String() }
+
+// SerializeWithArgs renders stmt as parameterized SQL: every literal value
+// other than NULL (which stays inline) is replaced by a placeholder ("?" for
+// MySQL, "$1", "$2", ... for dialects that report NumberedPlaceholders) and
+// returned alongside the query text,
+// so the result can be passed directly to database/sql. This is the
+// placeholder-producing counterpart to Statement.String.
+func SerializeWithArgs(stmt Statement, d Dialect) (string, []interface{}, error) {
+	w := &placeholderWriter{dialect: d}
+	if err := stmt.SerializeSql(d, w); err != nil {
+		return "", nil, err
+	}
+
+	args := make([]interface{}, len(w.args))
+	for i, a := range w.args {
+		args[i] = a
+	}
+	return w.buf.String(), args, nil
+}
+
 type orderByClause struct {
 	isOrderByClause
 	expression Expression
 	ascent     bool
 }
 
-func (o *orderByClause) SerializeSql(d Dialect, out *bytes.Buffer) error {
+func (o *orderByClause) SerializeSql(d Dialect, out Writer) error {
 	if o.expression == nil {
 		return fmt.Errorf(
 			"nil order by clause.  Generated sql: %s",
-			out.String())
+			describeWriter(out))
 	}
 
 	if err := o.expression.SerializeSql(d, out); err != nil {
@@ -35,9 +166,9 @@ func (o *orderByClause) SerializeSql(d Dialect, out *bytes.Buffer) error {
 	}
 
 	if o.ascent {
-		out.WriteString(" ASC")
+		io.WriteString(out, " ASC")
 	} else {
-		out.WriteString(" DESC")
+		io.WriteString(out, " DESC")
 	}
 
 	return nil
@@ -51,24 +182,153 @@ func Desc(expression Expression) OrderByClause {
 	return &orderByClause{expression: expression, ascent: false}
 }
 
+// describeWriter renders whatever has been written so far, for use in error
+// messages. Both writer implementations buffer internally, so this is
+// always available.
+func describeWriter(out Writer) string {
+	type stringer interface {
+		String() string
+	}
+	if s, ok := out.(stringer); ok {
+		return s.String()
+	}
+	return ""
+}
+
+// Precedence levels loosely mirror SQL (specifically MySQL's) operator
+// precedence. Serialization wraps a child expression in parentheses only
+// when the child's precedence is too low to appear unparenthesized as an
+// operand of its parent, which produces much quieter SQL than
+// unconditionally parenthesizing every composite node.
+//
+// Note that bitwise "^" binds tighter than "*"/"/" and "+"/"-" (it sits next
+// to the unary operators), while "&" and "|" both bind looser than "+"/"-" —
+// the reverse of what their visual grouping might suggest.
+const (
+	precedenceOr             = 3
+	precedenceAnd            = 4
+	precedenceComparison     = 6
+	precedenceBitOr          = 7
+	precedenceBitAnd         = 8
+	precedenceAdditive       = 9
+	precedenceMultiplicative = 10
+	precedenceBitXor         = 11
+	precedenceUnary          = 12
+	precedenceAtom           = 1 << 30
+)
+
+func operatorPrecedence(operator []byte) int {
+	switch string(operator) {
+	case " OR ":
+		return precedenceOr
+	case " AND ":
+		return precedenceAnd
+	case "=", "!=", "<", "<=", ">", ">=", " IS ", " IS NOT ", " LIKE ":
+		return precedenceComparison
+	case " | ":
+		return precedenceBitOr
+	case " ^ ":
+		return precedenceBitXor
+	case " & ":
+		return precedenceBitAnd
+	case " + ", " - ":
+		return precedenceAdditive
+	case " * ", " / ":
+		return precedenceMultiplicative
+	default:
+		return precedenceAtom
+	}
+}
+
+// isNonAssociative reports whether reordering operator's operands changes
+// its meaning, e.g. "-" and "/" but not "+" or "*". Their non-first operands
+// must be parenthesized even at equal precedence, to preserve e.g.
+// "a - (b - c)".
+func isNonAssociative(operator []byte) bool {
+	switch string(operator) {
+	case " - ", " / ":
+		return true
+	default:
+		return false
+	}
+}
+
+// needsMulDivGuard reports whether child must be parenthesized as a
+// non-first operand of a "*" chain specifically because it is rooted in
+// "/". "*" is associative with itself (a*(b*c) == (a*b)*c), so
+// isNonAssociative(" * ") is false — but mixing in "/" breaks that: SQL's
+// truncating integer division makes a*(b/c) and (a*b)/c different values
+// (e.g. a=3, b=2, c=4 gives 0 vs 1), even though both precedence levels are
+// equal and would otherwise serialize without parens.
+func needsMulDivGuard(operator []byte, child Expression) bool {
+	if string(operator) != " * " {
+		return false
+	}
+	arith, ok := child.(*arithmeticExpression)
+	return ok && string(arith.operator) == " / "
+}
+
+// maybeParenthesize serializes child, wrapping it in parentheses if its
+// precedence is too low to appear unparenthesized as an operand of a parent
+// with the given precedence. strict additionally requires parentheses when
+// the two precedences are equal.
+func maybeParenthesize(d Dialect, out Writer, parentPrecedence int, strict bool, child Expression) error {
+	childPrecedence := child.Precedence()
+	needsParens := childPrecedence < parentPrecedence ||
+		(strict && childPrecedence == parentPrecedence)
+
+	if needsParens {
+		out.Write([]byte{'('})
+	}
+	if err := child.SerializeSql(d, out); err != nil {
+		return err
+	}
+	if needsParens {
+		out.Write([]byte{')'})
+	}
+	return nil
+}
+
 // Representation of an escaped literal
 type literalExpression struct {
 	isExpression
-	value sqltypes.Value
+	value   sqltypes.Value
+	isBytes bool
 }
 
-func (c literalExpression) SerializeSql(d Dialect, out *bytes.Buffer) error {
-	sqltypes.Value(c.value).EncodeSql(out)
+func (c literalExpression) Precedence() int { return precedenceAtom }
+
+func (c literalExpression) SerializeSql(d Dialect, out Writer) error {
+	v := sqltypes.Value(c.value)
+
+	switch {
+	case v.IsNull():
+		out.WriteRaw(RawVal("NULL"))
+	case v.IsNumeric():
+		out.WriteNum(NumVal(v.Raw()))
+	case c.isBytes:
+		out.WriteBytes(BytesVal(v.Raw()))
+	case v.IsQuoted():
+		out.WriteStr(StrVal(v.Raw()))
+	default:
+		// Fall back to the value's own encoding for anything we don't
+		// otherwise recognize (e.g. sqltypes.Fractional). The bytes are
+		// already escaped, so they must not be quoted again.
+		buf := &bytes.Buffer{}
+		v.EncodeSql(buf)
+		out.WriteEncoded(EncodedVal(buf.Bytes()))
+	}
+
 	return nil
 }
 
-func serializeClauses(clauses []Clause, separator []byte, d Dialect, out *bytes.Buffer) (err error) {
+func serializeClauses(clauses []Clause, separator []byte, d Dialect, out Writer) (err error) {
 	if clauses == nil || len(clauses) == 0 {
-		return fmt.Errorf("Empty clauses. Generated sql: %s", out.String())
+		return fmt.Errorf("Empty clauses. Generated sql: %s", describeWriter(out))
 	}
 
 	if clauses[0] == nil {
-		return fmt.Errorf("nil clause. Generated sql: %s", out.String())
+		return fmt.Errorf("nil clause. Generated sql: %s", describeWriter(out))
 	}
 	if err = clauses[0].SerializeSql(d, out); err != nil {
 		return
@@ -78,7 +338,7 @@ func serializeClauses(clauses []Clause, separator []byte, d Dialect, out *bytes.
 		out.Write(separator)
 
 		if c == nil {
-			return fmt.Errorf("nil clause. Generated sql: %s", out.String())
+			return fmt.Errorf("nil clause. Generated sql: %s", describeWriter(out))
 		}
 		if err = c.SerializeSql(d, out); err != nil {
 			return
@@ -96,29 +356,35 @@ type conjunctExpression struct {
 	conjunction []byte
 }
 
-func (conj *conjunctExpression) SerializeSql(d Dialect, out *bytes.Buffer) (err error) {
+func (conj *conjunctExpression) Precedence() int {
+	return operatorPrecedence(conj.conjunction)
+}
+
+func (conj *conjunctExpression) SerializeSql(d Dialect, out Writer) (err error) {
 	if len(conj.expressions) == 0 {
 		return fmt.Errorf(
 			"Empty conjunction. Generated sql: %s",
-			out.String())
+			describeWriter(out))
 	}
 
-	clauses := make([]Clause, len(conj.expressions), len(conj.expressions))
-	for i, expr := range conj.expressions {
-		clauses[i] = expr
-	}
+	precedence := conj.Precedence()
 
-	useParentheses := len(clauses) > 1
-	if useParentheses {
-		out.WriteRune('(')
+	if conj.expressions[0] == nil {
+		return fmt.Errorf("nil clause. Generated sql: %s", describeWriter(out))
 	}
-
-	if err = serializeClauses(clauses, conj.conjunction, d, out); err != nil {
+	if err = maybeParenthesize(d, out, precedence, false, conj.expressions[0]); err != nil {
 		return
 	}
 
-	if useParentheses {
-		out.WriteRune(')')
+	for _, expr := range conj.expressions[1:] {
+		out.Write(conj.conjunction)
+
+		if expr == nil {
+			return fmt.Errorf("nil clause. Generated sql: %s", describeWriter(out))
+		}
+		if err = maybeParenthesize(d, out, precedence, false, expr); err != nil {
+			return
+		}
 	}
 
 	return nil
@@ -131,29 +397,37 @@ type arithmeticExpression struct {
 	operator    []byte
 }
 
-func (arith *arithmeticExpression) SerializeSql(d Dialect, out *bytes.Buffer) (err error) {
+func (arith *arithmeticExpression) Precedence() int {
+	return operatorPrecedence(arith.operator)
+}
+
+func (arith *arithmeticExpression) SerializeSql(d Dialect, out Writer) (err error) {
 	if len(arith.expressions) == 0 {
 		return fmt.Errorf(
 			"Empty arithmetic expression. Generated sql: %s",
-			out.String())
+			describeWriter(out))
 	}
 
-	clauses := make([]Clause, len(arith.expressions), len(arith.expressions))
-	for i, expr := range arith.expressions {
-		clauses[i] = expr
-	}
+	precedence := arith.Precedence()
+	strict := isNonAssociative(arith.operator)
 
-	useParentheses := len(clauses) > 1
-	if useParentheses {
-		out.WriteRune('(')
+	if arith.expressions[0] == nil {
+		return fmt.Errorf("nil clause. Generated sql: %s", describeWriter(out))
 	}
-
-	if err = serializeClauses(clauses, arith.operator, d, out); err != nil {
+	if err = maybeParenthesize(d, out, precedence, false, arith.expressions[0]); err != nil {
 		return
 	}
 
-	if useParentheses {
-		out.WriteRune(')')
+	for _, expr := range arith.expressions[1:] {
+		out.Write(arith.operator)
+
+		if expr == nil {
+			return fmt.Errorf("nil clause. Generated sql: %s", describeWriter(out))
+		}
+		childStrict := strict || needsMulDivGuard(arith.operator, expr)
+		if err = maybeParenthesize(d, out, precedence, childStrict, expr); err != nil {
+			return
+		}
 	}
 
 	return nil
@@ -164,7 +438,9 @@ type tupleExpression struct {
 	elements listClause
 }
 
-func (tuple *tupleExpression) SerializeSql(d Dialect, out *bytes.Buffer) error {
+func (tuple *tupleExpression) Precedence() int { return precedenceAtom }
+
+func (tuple *tupleExpression) SerializeSql(d Dialect, out Writer) error {
 	if len(tuple.elements.clauses) < 1 {
 		return fmt.Errorf("Tuples must include at least one element")
 	}
@@ -190,9 +466,9 @@ type listClause struct {
 	includeParentheses bool
 }
 
-func (list *listClause) SerializeSql(d Dialect, out *bytes.Buffer) error {
+func (list *listClause) SerializeSql(d Dialect, out Writer) error {
 	if list.includeParentheses {
-		out.WriteRune('(')
+		out.Write([]byte{'('})
 	}
 
 	if err := serializeClauses(list.clauses, []byte(","), d, out); err != nil {
@@ -200,7 +476,7 @@ func (list *listClause) SerializeSql(d Dialect, out *bytes.Buffer) error {
 	}
 
 	if list.includeParentheses {
-		out.WriteRune(')')
+		out.Write([]byte{')'})
 	}
 	return nil
 }
@@ -213,17 +489,22 @@ type negateExpression struct {
 	nested BoolExpression
 }
 
-func (c *negateExpression) SerializeSql(d Dialect, out *bytes.Buffer) (err error) {
-	out.WriteString("NOT (")
+// Precedence is reported as atomic: the "NOT (...)" form below always
+// parenthesizes its own nested expression, so the result never needs
+// additional parentheses from an enclosing expression.
+func (c *negateExpression) Precedence() int { return precedenceAtom }
+
+func (c *negateExpression) SerializeSql(d Dialect, out Writer) (err error) {
+	io.WriteString(out, "NOT (")
 
 	if c.nested == nil {
-		return fmt.Errorf("nil nested. Generated sql: %s", out.String())
+		return fmt.Errorf("nil nested. Generated sql: %s", describeWriter(out))
 	}
 	if err = c.nested.SerializeSql(d, out); err != nil {
 		return
 	}
 
-	out.WriteRune(')')
+	out.Write([]byte{')'})
 	return nil
 }
 
@@ -241,20 +522,25 @@ type binaryExpression struct {
 	operator []byte
 }
 
-func (c *binaryExpression) SerializeSql(d Dialect, out *bytes.Buffer) (err error) {
+func (c *binaryExpression) Precedence() int {
+	return operatorPrecedence(c.operator)
+}
+
+func (c *binaryExpression) SerializeSql(d Dialect, out Writer) (err error) {
 	if c.lhs == nil {
-		return fmt.Errorf("nil lhs. Generated sql: %s", out.String())
+		return fmt.Errorf("nil lhs. Generated sql: %s", describeWriter(out))
 	}
-	if err = c.lhs.SerializeSql(d, out); err != nil {
+	precedence := c.Precedence()
+	if err = maybeParenthesize(d, out, precedence, false, c.lhs); err != nil {
 		return
 	}
 
 	out.Write(c.operator)
 
 	if c.rhs == nil {
-		return fmt.Errorf("nil rhs. Generated sql: %s", out.String())
+		return fmt.Errorf("nil rhs. Generated sql: %s", describeWriter(out))
 	}
-	if err = c.rhs.SerializeSql(d, out); err != nil {
+	if err = maybeParenthesize(d, out, precedence, isNonAssociative(c.operator), c.rhs); err != nil {
 		return
 	}
 
@@ -282,16 +568,18 @@ type funcExpression struct {
 	args     *listClause
 }
 
-func (c *funcExpression) SerializeSql(d Dialect, out *bytes.Buffer) (err error) {
+func (c *funcExpression) Precedence() int { return precedenceAtom }
+
+func (c *funcExpression) SerializeSql(d Dialect, out Writer) (err error) {
 	if !validIdentifierName(c.funcName) {
 		return fmt.Errorf(
 			"Invalid function name: %s. Generated sql: %s",
 			c.funcName,
-			out.String())
+			describeWriter(out))
 	}
-	out.WriteString(c.funcName)
+	io.WriteString(out, c.funcName)
 	if c.args == nil {
-		out.WriteString("()")
+		io.WriteString(out, "()")
 	} else {
 		return c.args.SerializeSql(d, out)
 	}
@@ -329,7 +617,8 @@ func Literal(v interface{}) Expression {
 	if err != nil {
 		panic("sqlbuilder: invalid literal value: " + err.Error())
 	}
-	return &literalExpression{value: value}
+	_, isBytes := v.([]byte)
+	return &literalExpression{value: value, isBytes: isBytes}
 }
 
 // Returns a representation of "c[0] AND ... AND c[n-1]" for c in clauses
@@ -507,7 +796,9 @@ type inExpression struct {
 	err error
 }
 
-func (c *inExpression) SerializeSql(d Dialect, out *bytes.Buffer) error {
+func (c *inExpression) Precedence() int { return precedenceComparison }
+
+func (c *inExpression) SerializeSql(d Dialect, out Writer) error {
 	if c.err != nil {
 		return errors.New("Invalid IN expression: " + c.err.Error())
 	}
@@ -515,112 +806,34 @@ func (c *inExpression) SerializeSql(d Dialect, out *bytes.Buffer) error {
 	if c.lhs == nil {
 		return fmt.Errorf(
 			"lhs of in expression is nil. Generated sql: %s",
-			out.String(),
+			describeWriter(out),
 		)
 	}
 
-	// We'll serialize the lhs even if we don't need it to ensure no error
-	buf := &bytes.Buffer{}
-
-	err := c.lhs.SerializeSql(d, buf)
-	if err != nil {
-		return err
-	}
-
 	if c.rhs == nil {
-		out.WriteString("FALSE")
+		// Still serialize the lhs so that an invalid lhs surfaces its own
+		// error, even though the overall expression is always false.
+		if err := c.lhs.SerializeSql(d, &standardWriter{}); err != nil {
+			return err
+		}
+		io.WriteString(out, "FALSE")
 		return nil
 	}
 
-	out.WriteString(buf.String())
-	out.WriteString(" IN ")
-
-	err = c.rhs.SerializeSql(d, out)
-	if err != nil {
+	if err := c.lhs.SerializeSql(d, out); err != nil {
 		return err
 	}
 
-	return nil
+	io.WriteString(out, " IN ")
+
+	return c.rhs.SerializeSql(d, out)
 }
 
 // Returns a representation of "a IN (b[0], ..., b[n-1])", where b is a list
 // of literals valList must be a slice type
 func In(lhs Expression, valList interface{}) BoolExpression {
-	var clauses []Clause
-	switch val := valList.(type) {
-	// This atrocious body of copy-paste code is due to the fact that if you
-	// try to merge the cases, you can't treat val as a list
-	case []int:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []int32:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []int64:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []uint:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []uint32:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []uint64:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []float64:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []string:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case [][]byte:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []time.Time:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []sqltypes.Numeric:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []sqltypes.Fractional:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []sqltypes.String:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	case []sqltypes.Value:
-		clauses = make([]Clause, 0, len(val))
-		for _, v := range val {
-			clauses = append(clauses, Literal(v))
-		}
-	default:
+	val := reflect.ValueOf(valList)
+	if val.Kind() != reflect.Slice {
 		return &inExpression{
 			err: fmt.Errorf(
 				"Unknown value list type in IN clause: %s",
@@ -628,6 +841,38 @@ func In(lhs Expression, valList interface{}) BoolExpression {
 		}
 	}
 
+	clauses := make([]Clause, 0, val.Len())
+	for i := 0; i < val.Len(); i++ {
+		elem := val.Index(i).Interface()
+
+		// Build the literal directly instead of going through Literal(),
+		// which panics on an unsupported type: a bad element here should
+		// surface as a normal SerializeSql error like every other node in
+		// this file, not crash the process before serialization starts.
+		value, err := sqltypes.BuildValue(elem)
+		if err != nil {
+			// BuildValue only recognizes predeclared Go types, so retry a
+			// named type (e.g. type UserID int64) as its underlying kind.
+			switch ev := val.Index(i); ev.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				value, err = sqltypes.BuildValue(ev.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				value, err = sqltypes.BuildValue(ev.Uint())
+			case reflect.Float32, reflect.Float64:
+				value, err = sqltypes.BuildValue(ev.Float())
+			case reflect.String:
+				value, err = sqltypes.BuildValue(ev.String())
+			}
+		}
+		if err != nil {
+			return &inExpression{
+				err: fmt.Errorf("invalid element %d in IN clause: %s", i, err),
+			}
+		}
+		_, isBytes := elem.([]byte)
+		clauses = append(clauses, &literalExpression{value: value, isBytes: isBytes})
+	}
+
 	expr := &inExpression{lhs: lhs}
 	if len(clauses) > 0 {
 		expr.rhs = &listClause{clauses: clauses, includeParentheses: true}
@@ -635,6 +880,79 @@ func In(lhs Expression, valList interface{}) BoolExpression {
 	return expr
 }
 
+// Representation of "expr [NOT] BETWEEN lo AND hi". Modeled as its own node
+// rather than sugar over And(Gte(...), Lte(...)) so that a dialect can
+// override the lowering later; the surface AST still exposes a BETWEEN
+// node even if a given dialect rewrites it at serialization time.
+type betweenExpression struct {
+	isExpression
+	isBoolExpression
+
+	expr, lo, hi Expression
+	negated      bool
+}
+
+func (c *betweenExpression) Precedence() int { return precedenceComparison }
+
+func (c *betweenExpression) SerializeSql(d Dialect, out Writer) error {
+	if c.expr == nil {
+		return fmt.Errorf("nil expr in BETWEEN expression. Generated sql: %s", describeWriter(out))
+	}
+	if c.lo == nil {
+		return fmt.Errorf("nil lo in BETWEEN expression. Generated sql: %s", describeWriter(out))
+	}
+	if c.hi == nil {
+		return fmt.Errorf("nil hi in BETWEEN expression. Generated sql: %s", describeWriter(out))
+	}
+
+	if err := c.expr.SerializeSql(d, out); err != nil {
+		return err
+	}
+
+	if c.negated {
+		io.WriteString(out, " NOT BETWEEN ")
+	} else {
+		io.WriteString(out, " BETWEEN ")
+	}
+
+	precedence := c.Precedence()
+
+	// lo and hi are parenthesized whenever their own precedence is too low
+	// to appear unparenthesized here, e.g. a BoolExpression like And(...)
+	// passed as hi: without this, its own " AND " would merge with
+	// BETWEEN's, changing "x BETWEEN lo AND (y AND z)" into
+	// "x BETWEEN lo AND y AND z".
+	if err := maybeParenthesize(d, out, precedence, false, c.lo); err != nil {
+		return err
+	}
+
+	io.WriteString(out, " AND ")
+
+	return maybeParenthesize(d, out, precedence, false, c.hi)
+}
+
+// Between returns a representation of "expr BETWEEN lo AND hi"
+func Between(expr, lo, hi Expression) BoolExpression {
+	return &betweenExpression{expr: expr, lo: lo, hi: hi}
+}
+
+// NotBetween returns a representation of "expr NOT BETWEEN lo AND hi"
+func NotBetween(expr, lo, hi Expression) BoolExpression {
+	return &betweenExpression{expr: expr, lo: lo, hi: hi, negated: true}
+}
+
+// BetweenL returns a representation of "expr BETWEEN lo AND hi", where lo
+// and hi are literals
+func BetweenL(expr Expression, lo, hi interface{}) BoolExpression {
+	return Between(expr, Literal(lo), Literal(hi))
+}
+
+// NotBetweenL returns a representation of "expr NOT BETWEEN lo AND hi",
+// where lo and hi are literals
+func NotBetweenL(expr Expression, lo, hi interface{}) BoolExpression {
+	return NotBetween(expr, Literal(lo), Literal(hi))
+}
+
 type inSubqueryExpression struct {
 	isExpression
 	isBoolExpression
@@ -651,21 +969,16 @@ func InQ(lhs Expression, rhs SubqueryClause) BoolExpression {
 	}
 }
 
-func (c *inSubqueryExpression) SerializeSql(d Dialect, out *bytes.Buffer) error {
-	buf := &bytes.Buffer{}
+func (c *inSubqueryExpression) Precedence() int { return precedenceComparison }
 
-	if err := c.lhs.SerializeSql(d, buf); err != nil {
+func (c *inSubqueryExpression) SerializeSql(d Dialect, out Writer) error {
+	if err := c.lhs.SerializeSql(d, out); err != nil {
 		return err
 	}
 
-	out.WriteString(buf.String())
-	out.WriteString(" IN ")
+	io.WriteString(out, " IN ")
 
-	if err := c.rhs.SerializeSql(d, out); err != nil {
-		return err
-	}
-
-	return nil
+	return c.rhs.SerializeSql(d, out)
 }
 
 type ifExpression struct {
@@ -675,19 +988,54 @@ type ifExpression struct {
 	falseExpression Expression
 }
 
-func (exp *ifExpression) SerializeSql(d Dialect, out *bytes.Buffer) error {
-	out.WriteString("IF(")
-	exp.conditional.SerializeSql(d, out)
-	out.WriteRune(',')
-	exp.trueExpression.SerializeSql(d, out)
-	out.WriteRune(',')
-	exp.falseExpression.SerializeSql(d, out)
-	out.WriteRune(')')
+// caseLoweringDialect is implemented by dialects (e.g. Postgres/ANSI) that
+// don't support MySQL's IF(cond, a, b) and want it lowered to the
+// equivalent CASE WHEN ... THEN ... ELSE ... END instead.
+type caseLoweringDialect interface {
+	Dialect
+	LowersIfToCase() bool
+}
+
+// AnsiDialect wraps a base Dialect and reports that IF(...) should be
+// lowered to CASE WHEN ... THEN ... ELSE ... END rather than emitted as
+// MySQL's IF() function. Wrap any dialect that follows the ANSI/Postgres
+// convention with it, e.g. sqlbuilder.AnsiDialect{Dialect: PostgresDialect}.
+type AnsiDialect struct {
+	Dialect
+}
+
+// LowersIfToCase reports true: AnsiDialect always rewrites If(...) as CASE.
+func (AnsiDialect) LowersIfToCase() bool { return true }
+
+func (exp *ifExpression) Precedence() int { return precedenceAtom }
+
+func (exp *ifExpression) SerializeSql(d Dialect, out Writer) error {
+	if ld, ok := d.(caseLoweringDialect); ok && ld.LowersIfToCase() {
+		return Case().When(exp.conditional, exp.trueExpression).
+			Else(exp.falseExpression).SerializeSql(d, out)
+	}
+
+	io.WriteString(out, "IF(")
+	if err := exp.conditional.SerializeSql(d, out); err != nil {
+		return err
+	}
+	out.Write([]byte{','})
+	if err := exp.trueExpression.SerializeSql(d, out); err != nil {
+		return err
+	}
+	out.Write([]byte{','})
+	if err := exp.falseExpression.SerializeSql(d, out); err != nil {
+		return err
+	}
+	out.Write([]byte{')'})
 	return nil
 }
 
 // Returns a representation of an if-expression, of the form:
 //   IF (BOOLEAN TEST, VALUE-IF-TRUE, VALUE-IF-FALSE)
+// On a dialect that reports LowersIfToCase (such as one wrapped in
+// AnsiDialect), this is lowered to the equivalent CASE WHEN ... THEN ...
+// ELSE ... END; every other dialect gets IF(...) as written.
 func If(conditional BoolExpression, trueExpression Expression, falseExpression Expression) Expression {
 	return &ifExpression{
 		conditional:     conditional,
@@ -696,6 +1044,156 @@ func If(conditional BoolExpression, trueExpression Expression, falseExpression E
 	}
 }
 
+// Representation of a standard SQL CASE expression, in both searched form
+// (CASE WHEN bool THEN v ... END) and simple form (CASE operand WHEN v THEN
+// r ... END). Exactly one of each when's cond/val is set, matching whether
+// operand is nil.
+type caseExpression struct {
+	isExpression
+	operand Expression
+	whens   []struct {
+		cond BoolExpression
+		val  Expression
+	}
+	results  []Expression
+	elseExpr Expression
+}
+
+func (c *caseExpression) Precedence() int { return precedenceAtom }
+
+func (c *caseExpression) SerializeSql(d Dialect, out Writer) error {
+	if len(c.whens) == 0 {
+		return fmt.Errorf("CASE expression must have at least one WHEN")
+	}
+
+	io.WriteString(out, "CASE")
+
+	if c.operand != nil {
+		out.Write([]byte{' '})
+		if err := c.operand.SerializeSql(d, out); err != nil {
+			return err
+		}
+	}
+
+	for i, w := range c.whens {
+		io.WriteString(out, " WHEN ")
+
+		if c.operand != nil {
+			if w.val == nil {
+				return fmt.Errorf("nil WHEN value in CASE expression. Generated sql: %s", describeWriter(out))
+			}
+			if err := w.val.SerializeSql(d, out); err != nil {
+				return err
+			}
+		} else {
+			if w.cond == nil {
+				return fmt.Errorf("nil WHEN condition in CASE expression. Generated sql: %s", describeWriter(out))
+			}
+			if err := w.cond.SerializeSql(d, out); err != nil {
+				return err
+			}
+		}
+
+		io.WriteString(out, " THEN ")
+		if c.results[i] == nil {
+			return fmt.Errorf("nil THEN result in CASE expression. Generated sql: %s", describeWriter(out))
+		}
+		if err := c.results[i].SerializeSql(d, out); err != nil {
+			return err
+		}
+	}
+
+	if c.elseExpr != nil {
+		io.WriteString(out, " ELSE ")
+		if err := c.elseExpr.SerializeSql(d, out); err != nil {
+			return err
+		}
+	}
+
+	io.WriteString(out, " END")
+	return nil
+}
+
+// CaseBuilder builds up a searched CASE expression via a fluent When/Else
+// chain:
+//   Case().When(cond1, val1).When(cond2, val2).Else(val3)
+// produces CASE WHEN cond1 THEN val1 WHEN cond2 THEN val2 ELSE val3 END.
+type CaseBuilder struct {
+	expr *caseExpression
+}
+
+// Case starts a searched CASE expression.
+func Case() *CaseBuilder {
+	return &CaseBuilder{expr: &caseExpression{}}
+}
+
+// When adds a "WHEN cond THEN result" clause.
+func (b *CaseBuilder) When(cond BoolExpression, result Expression) *CaseBuilder {
+	b.expr.whens = append(b.expr.whens, struct {
+		cond BoolExpression
+		val  Expression
+	}{cond: cond})
+	b.expr.results = append(b.expr.results, result)
+	return b
+}
+
+// Else sets the CASE expression's ELSE clause and returns the built
+// Expression.
+func (b *CaseBuilder) Else(result Expression) Expression {
+	b.expr.elseExpr = result
+	return b.expr
+}
+
+func (b *CaseBuilder) Precedence() int { return precedenceAtom }
+
+// SerializeSql allows a CaseBuilder to be used directly as an Expression
+// (with no ELSE clause) without an explicit trailing call to Else.
+func (b *CaseBuilder) SerializeSql(d Dialect, out Writer) error {
+	return b.expr.SerializeSql(d, out)
+}
+
+// SimpleCaseBuilder builds up a simple CASE expression, comparing operand
+// against each When's value, via a fluent When/Else chain:
+//   CaseOn(col).When(v1, r1).When(v2, r2).Else(r3)
+// produces CASE col WHEN v1 THEN r1 WHEN v2 THEN r2 ELSE r3 END.
+type SimpleCaseBuilder struct {
+	expr *caseExpression
+}
+
+// CaseOn starts a simple CASE expression comparing operand against each
+// When's value.
+func CaseOn(operand Expression) *SimpleCaseBuilder {
+	return &SimpleCaseBuilder{expr: &caseExpression{operand: operand}}
+}
+
+// When adds a "WHEN val THEN result" clause, where val is compared against
+// the CaseOn operand. val is typically a literal (EqL's literal argument)
+// but may be any Expression.
+func (b *SimpleCaseBuilder) When(val Expression, result Expression) *SimpleCaseBuilder {
+	b.expr.whens = append(b.expr.whens, struct {
+		cond BoolExpression
+		val  Expression
+	}{val: val})
+	b.expr.results = append(b.expr.results, result)
+	return b
+}
+
+// Else sets the CASE expression's ELSE clause and returns the built
+// Expression.
+func (b *SimpleCaseBuilder) Else(result Expression) Expression {
+	b.expr.elseExpr = result
+	return b.expr
+}
+
+func (b *SimpleCaseBuilder) Precedence() int { return precedenceAtom }
+
+// SerializeSql allows a SimpleCaseBuilder to be used directly as an
+// Expression (with no ELSE clause) without an explicit trailing call to
+// Else.
+func (b *SimpleCaseBuilder) SerializeSql(d Dialect, out Writer) error {
+	return b.expr.SerializeSql(d, out)
+}
+
 type columnValueExpression struct {
 	isExpression
 	column NonAliasColumn
@@ -707,10 +1205,12 @@ func ColumnValue(col NonAliasColumn) Expression {
 	}
 }
 
-func (cv *columnValueExpression) SerializeSql(d Dialect, out *bytes.Buffer) error {
-	out.WriteString("VALUES(")
+func (cv *columnValueExpression) Precedence() int { return precedenceAtom }
+
+func (cv *columnValueExpression) SerializeSql(d Dialect, out Writer) error {
+	io.WriteString(out, "VALUES(")
 	cv.column.SerializeSqlForColumnList(true, d, out)
-	out.WriteRune(')')
+	out.Write([]byte{')'})
 	return nil
 }
 
@@ -725,13 +1225,227 @@ type subqueryExpression struct {
 	stmt Statement
 }
 
-func (exp *subqueryExpression) SerializeSql(db Dialect, out *bytes.Buffer) error {
-	out.WriteRune('(')
-	subquery, err := exp.stmt.String(db)
-	if err != nil {
+func (exp *subqueryExpression) Precedence() int { return precedenceAtom }
+
+func (exp *subqueryExpression) SerializeSql(d Dialect, out Writer) error {
+	out.Write([]byte{'('})
+	if err := exp.stmt.SerializeSql(d, out); err != nil {
 		return err
 	}
-	out.WriteString(subquery)
-	out.WriteRune(')')
+	out.Write([]byte{')'})
 	return nil
 }
+
+// FrameKind selects the unit a window frame is measured in.
+type FrameKind int
+
+const (
+	RowsFrame FrameKind = iota
+	RangeFrame
+	GroupsFrame
+)
+
+func (k FrameKind) sql() string {
+	switch k {
+	case RangeFrame:
+		return "RANGE"
+	case GroupsFrame:
+		return "GROUPS"
+	default:
+		return "ROWS"
+	}
+}
+
+// FrameBoundKind selects one of the five standard window frame bound forms.
+type FrameBoundKind int
+
+const (
+	UnboundedPreceding FrameBoundKind = iota
+	Preceding
+	CurrentRow
+	Following
+	UnboundedFollowing
+)
+
+// FrameBound is one endpoint of a window frame's BETWEEN ... AND ... clause,
+// e.g. "3 PRECEDING" or "CURRENT ROW".
+type FrameBound struct {
+	kind   FrameBoundKind
+	offset uint64
+}
+
+// UnboundedPrecedingBound returns the "UNBOUNDED PRECEDING" frame bound.
+func UnboundedPrecedingBound() FrameBound {
+	return FrameBound{kind: UnboundedPreceding}
+}
+
+// PrecedingBound returns the "n PRECEDING" frame bound.
+func PrecedingBound(n uint64) FrameBound {
+	return FrameBound{kind: Preceding, offset: n}
+}
+
+// CurrentRowBound returns the "CURRENT ROW" frame bound.
+func CurrentRowBound() FrameBound {
+	return FrameBound{kind: CurrentRow}
+}
+
+// FollowingBound returns the "n FOLLOWING" frame bound.
+func FollowingBound(n uint64) FrameBound {
+	return FrameBound{kind: Following, offset: n}
+}
+
+// UnboundedFollowingBound returns the "UNBOUNDED FOLLOWING" frame bound.
+func UnboundedFollowingBound() FrameBound {
+	return FrameBound{kind: UnboundedFollowing}
+}
+
+func (b FrameBound) serializeSql(out Writer) {
+	switch b.kind {
+	case UnboundedPreceding:
+		io.WriteString(out, "UNBOUNDED PRECEDING")
+	case Preceding:
+		fmt.Fprintf(out, "%d PRECEDING", b.offset)
+	case CurrentRow:
+		io.WriteString(out, "CURRENT ROW")
+	case Following:
+		fmt.Fprintf(out, "%d FOLLOWING", b.offset)
+	case UnboundedFollowing:
+		io.WriteString(out, "UNBOUNDED FOLLOWING")
+	}
+}
+
+// windowFrame is a window function's optional ROWS/RANGE/GROUPS BETWEEN ...
+// AND ... clause.
+type windowFrame struct {
+	kind       FrameKind
+	start, end FrameBound
+}
+
+// WindowExpression wraps a function expression (typically built by SqlFunc,
+// Sum, RowNumber, etc.) with an OVER (PARTITION BY ... ORDER BY ... frame)
+// clause.
+type WindowExpression struct {
+	isExpression
+	fn          Expression
+	partitionBy []Expression
+	orderBy     []OrderByClause
+	frame       *windowFrame
+}
+
+// Over wraps fn (e.g. Sum(col) or RowNumber()) in a window expression. Use
+// the returned builder's PartitionBy, OrderBy and Frame methods to fill in
+// the OVER (...) clause.
+func Over(fn Expression) *WindowExpression {
+	return &WindowExpression{fn: fn}
+}
+
+// PartitionBy sets the window's PARTITION BY clause.
+func (w *WindowExpression) PartitionBy(exprs ...Expression) *WindowExpression {
+	w.partitionBy = exprs
+	return w
+}
+
+// OrderBy sets the window's ORDER BY clause.
+func (w *WindowExpression) OrderBy(clauses ...OrderByClause) *WindowExpression {
+	w.orderBy = clauses
+	return w
+}
+
+// Frame sets the window's frame clause, e.g.
+//   Frame(RowsFrame, UnboundedPrecedingBound(), CurrentRowBound())
+// for "ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW".
+func (w *WindowExpression) Frame(kind FrameKind, start, end FrameBound) *WindowExpression {
+	w.frame = &windowFrame{kind: kind, start: start, end: end}
+	return w
+}
+
+func (w *WindowExpression) Precedence() int { return precedenceAtom }
+
+func (w *WindowExpression) SerializeSql(d Dialect, out Writer) error {
+	if w.fn == nil {
+		return fmt.Errorf("nil function in window expression")
+	}
+	if err := w.fn.SerializeSql(d, out); err != nil {
+		return err
+	}
+
+	io.WriteString(out, " OVER (")
+
+	wroteClause := false
+
+	if len(w.partitionBy) > 0 {
+		io.WriteString(out, "PARTITION BY ")
+		for i, expr := range w.partitionBy {
+			if i > 0 {
+				io.WriteString(out, ", ")
+			}
+			if expr == nil {
+				return fmt.Errorf("nil PARTITION BY expression in window expression. Generated sql: %s", describeWriter(out))
+			}
+			if err := expr.SerializeSql(d, out); err != nil {
+				return err
+			}
+		}
+		wroteClause = true
+	}
+
+	if len(w.orderBy) > 0 {
+		if wroteClause {
+			out.Write([]byte{' '})
+		}
+		io.WriteString(out, "ORDER BY ")
+		for i, clause := range w.orderBy {
+			if i > 0 {
+				io.WriteString(out, ", ")
+			}
+			if clause == nil {
+				return fmt.Errorf("nil ORDER BY clause in window expression. Generated sql: %s", describeWriter(out))
+			}
+			if err := clause.SerializeSql(d, out); err != nil {
+				return err
+			}
+		}
+		wroteClause = true
+	}
+
+	if w.frame != nil {
+		if wroteClause {
+			out.Write([]byte{' '})
+		}
+		io.WriteString(out, w.frame.kind.sql())
+		io.WriteString(out, " BETWEEN ")
+		w.frame.start.serializeSql(out)
+		io.WriteString(out, " AND ")
+		w.frame.end.serializeSql(out)
+	}
+
+	out.Write([]byte{')'})
+	return nil
+}
+
+// RowNumber returns the window function ROW_NUMBER(), for use with Over.
+func RowNumber() Expression {
+	return SqlFunc("ROW_NUMBER")
+}
+
+// Rank returns the window function RANK(), for use with Over.
+func Rank() Expression {
+	return SqlFunc("RANK")
+}
+
+// DenseRank returns the window function DENSE_RANK(), for use with Over.
+func DenseRank() Expression {
+	return SqlFunc("DENSE_RANK")
+}
+
+// Lag returns the window function LAG(expr, n, defaultVal), for use with
+// Over.
+func Lag(expr Expression, n uint64, defaultVal Expression) Expression {
+	return SqlFunc("LAG", expr, Literal(n), defaultVal)
+}
+
+// Lead returns the window function LEAD(expr, n, defaultVal), for use with
+// Over.
+func Lead(expr Expression, n uint64, defaultVal Expression) Expression {
+	return SqlFunc("LEAD", expr, Literal(n), defaultVal)
+}
@@ -0,0 +1,409 @@
+// Copyright 2015 CoreOS, Inc. All rights reserved.
+// Copyright 2014 Dropbox, Inc. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license,
+// which can be found in the LICENSE file.
+
+package sqlbuilder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+// testIdent is a bare identifier Expression (standing in for a column
+// reference) used to keep these tests independent of the NonAliasColumn
+// implementations that live elsewhere in the package.
+type testIdent string
+
+func (i testIdent) Precedence() int { return precedenceAtom }
+
+func (i testIdent) SerializeSql(d Dialect, out Writer) error {
+	_, err := io.WriteString(out, string(i))
+	return err
+}
+
+func serialize(t *testing.T, expr Expression) string {
+	w := &standardWriter{}
+	if err := expr.SerializeSql(nil, w); err != nil {
+		t.Fatalf("SerializeSql: %v", err)
+	}
+	return w.String()
+}
+
+// exprStatement adapts an Expression into a Statement, so SerializeWithArgs
+// (which takes a Statement) can be exercised directly against the
+// expressions built in the tests below.
+type exprStatement struct {
+	expr Expression
+}
+
+func (s exprStatement) SerializeSql(d Dialect, out Writer) error {
+	return s.expr.SerializeSql(d, out)
+}
+
+// numberedDialect reports NumberedPlaceholders true, standing in for a
+// Postgres-like dialect in SerializeWithArgs tests.
+type numberedDialect struct {
+	Dialect
+}
+
+func (numberedDialect) NumberedPlaceholders() bool { return true }
+
+func argStrings(args []interface{}) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		b, ok := a.([]byte)
+		if !ok {
+			out[i] = fmt.Sprintf("%v", a)
+			continue
+		}
+		out[i] = string(b)
+	}
+	return out
+}
+
+func TestSerializeWithArgsMySQLPlaceholders(t *testing.T) {
+	stmt := exprStatement{expr: And(EqL(testIdent("x"), 1), EqL(testIdent("y"), "hi"))}
+
+	sql, args, err := SerializeWithArgs(stmt, nil)
+	if err != nil {
+		t.Fatalf("SerializeWithArgs: %v", err)
+	}
+
+	wantSql := "x=? AND y=?"
+	if sql != wantSql {
+		t.Errorf("sql: got %q, want %q", sql, wantSql)
+	}
+
+	wantArgs := []string{"1", "hi"}
+	if got := argStrings(args); !reflect.DeepEqual(got, wantArgs) {
+		t.Errorf("args: got %v, want %v", got, wantArgs)
+	}
+}
+
+func TestSerializeWithArgsNumberedPlaceholders(t *testing.T) {
+	stmt := exprStatement{expr: And(EqL(testIdent("x"), 1), EqL(testIdent("y"), "hi"))}
+
+	sql, args, err := SerializeWithArgs(stmt, numberedDialect{})
+	if err != nil {
+		t.Fatalf("SerializeWithArgs: %v", err)
+	}
+
+	wantSql := "x=$1 AND y=$2"
+	if sql != wantSql {
+		t.Errorf("sql: got %q, want %q", sql, wantSql)
+	}
+
+	wantArgs := []string{"1", "hi"}
+	if got := argStrings(args); !reflect.DeepEqual(got, wantArgs) {
+		t.Errorf("args: got %v, want %v", got, wantArgs)
+	}
+}
+
+func TestSerializeWithArgsSubqueryLiteralsLifted(t *testing.T) {
+	inner := exprStatement{expr: EqL(testIdent("b"), 5)}
+	outer := exprStatement{expr: InQ(testIdent("a"), Subquery(inner))}
+
+	sql, args, err := SerializeWithArgs(outer, nil)
+	if err != nil {
+		t.Fatalf("SerializeWithArgs: %v", err)
+	}
+
+	wantSql := "a IN (b=?)"
+	if sql != wantSql {
+		t.Errorf("sql: got %q, want %q", sql, wantSql)
+	}
+
+	wantArgs := []string{"5"}
+	if got := argStrings(args); !reflect.DeepEqual(got, wantArgs) {
+		t.Errorf("args: got %v, want %v (subquery literal was not lifted into args)", got, wantArgs)
+	}
+}
+
+func TestSerializeWithArgsNullLiteralIsRaw(t *testing.T) {
+	stmt := exprStatement{expr: EqL(testIdent("x"), nil)}
+
+	sql, args, err := SerializeWithArgs(stmt, nil)
+	if err != nil {
+		t.Fatalf("SerializeWithArgs: %v", err)
+	}
+
+	wantSql := "x IS NULL"
+	if sql != wantSql {
+		t.Errorf("sql: got %q, want %q", sql, wantSql)
+	}
+	if len(args) != 0 {
+		t.Errorf("args: got %v, want none (NULL must not become a placeholder)", args)
+	}
+}
+
+// TestStandardWriterQuotingMatchesEncodeSql pins standardWriter's quoting of
+// StrVal/BytesVal literals to sqltypes.Value.EncodeSql byte-for-byte, for
+// the special bytes EncodeSql is known to escape beyond a bare quote and
+// backslash (NUL, newline, CR, \x1a). standardWriter must keep delegating
+// to EncodeSql rather than drifting into its own, incomplete escaper.
+func TestStandardWriterQuotingMatchesEncodeSql(t *testing.T) {
+	cases := []string{
+		"plain",
+		`it's a test`,
+		`back\slash`,
+		"nul\x00byte",
+		"new\nline",
+		"carriage\rreturn",
+		"ctrl\x1az",
+		`quote"and'both\and\x00mixed`,
+	}
+
+	for _, s := range cases {
+		t.Run(s, func(t *testing.T) {
+			got := serialize(t, Literal(s))
+
+			value, err := sqltypes.BuildValue(s)
+			if err != nil {
+				t.Fatalf("BuildValue: %v", err)
+			}
+			want := &bytes.Buffer{}
+			value.EncodeSql(want)
+
+			if got != want.String() {
+				t.Errorf("got %q, want %q (standardWriter must match sqltypes.Value.EncodeSql)", got, want.String())
+			}
+
+			// Same bytes, but as a BytesVal literal ([]byte) rather than a
+			// StrVal one (string); both route through writeQuoted.
+			gotBytes := serialize(t, Literal([]byte(s)))
+			bytesValue, err := sqltypes.BuildValue([]byte(s))
+			if err != nil {
+				t.Fatalf("BuildValue: %v", err)
+			}
+			wantBytes := &bytes.Buffer{}
+			bytesValue.EncodeSql(wantBytes)
+
+			if gotBytes != wantBytes.String() {
+				t.Errorf("got %q, want %q (standardWriter must match sqltypes.Value.EncodeSql for []byte)", gotBytes, wantBytes.String())
+			}
+		})
+	}
+}
+
+func TestArithmeticPrecedenceParenthesization(t *testing.T) {
+	a, b, c := testIdent("a"), testIdent("b"), testIdent("c")
+
+	cases := []struct {
+		name string
+		expr Expression
+		want string
+	}{
+		{
+			name: "mul binds tighter than add, no parens needed",
+			expr: Add(a, Mul(b, c)),
+			want: "a + b * c",
+		},
+		{
+			name: "add nested under mul needs parens",
+			expr: Mul(Add(a, b), c),
+			want: "(a + b) * c",
+		},
+		{
+			name: "left-associative sub chain needs no parens",
+			expr: Sub(Sub(a, b), c),
+			want: "a - b - c",
+		},
+		{
+			name: "sub as non-first operand of sub needs parens",
+			expr: Sub(a, Sub(b, c)),
+			want: "a - (b - c)",
+		},
+		{
+			name: "div as non-first operand of div needs parens",
+			expr: Div(a, Div(b, c)),
+			want: "a / (b / c)",
+		},
+		{
+			name: "div as non-first operand of mul needs parens",
+			expr: Mul(a, Div(b, c)),
+			want: "a * (b / c)",
+		},
+		{
+			name: "mul as non-first operand of mul needs no parens",
+			expr: Mul(a, Mul(b, c)),
+			want: "a * b * c",
+		},
+		{
+			name: "bitwise xor binds tighter than add",
+			expr: BitXor(Add(a, b), c),
+			want: "(a + b) ^ c",
+		},
+		{
+			name: "add of bitwise xor needs no parens",
+			expr: Add(a, &binaryExpression{lhs: b, rhs: c, operator: []byte(" ^ ")}),
+			want: "a + b ^ c",
+		},
+		{
+			name: "bitwise and binds looser than add",
+			expr: &binaryExpression{
+				lhs:      &binaryExpression{lhs: a, rhs: b, operator: []byte(" + ")},
+				rhs:      c,
+				operator: []byte(" & "),
+			},
+			want: "a + b & c",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := serialize(t, tc.expr); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConjunctPrecedenceParenthesization(t *testing.T) {
+	x := EqL(testIdent("x"), 1)
+	y := EqL(testIdent("y"), 2)
+	z := EqL(testIdent("z"), 3)
+
+	got := serialize(t, And(Or(x, y), z))
+	want := "(x=1 OR y=2) AND z=3"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = serialize(t, Or(x, And(y, z)))
+	want = "x=1 OR y=2 AND z=3"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCaseSearchedForm(t *testing.T) {
+	score := testIdent("score")
+	expr := Case().
+		When(GtL(score, 90), Literal("A")).
+		When(GtL(score, 80), Literal("B")).
+		Else(Literal("C"))
+
+	got := serialize(t, expr)
+	want := "CASE WHEN score>90 THEN 'A' WHEN score>80 THEN 'B' ELSE 'C' END"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCaseSimpleForm(t *testing.T) {
+	expr := CaseOn(testIdent("status")).
+		When(Literal("ok"), Literal(1)).
+		Else(Literal(0))
+
+	got := serialize(t, expr)
+	want := "CASE status WHEN 'ok' THEN 1 ELSE 0 END"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCaseNilWhenReturnsError(t *testing.T) {
+	expr := Case().When(nil, Literal(1)).Else(Literal(0))
+	w := &standardWriter{}
+	if err := expr.SerializeSql(nil, w); err == nil {
+		t.Fatal("expected an error for a nil WHEN condition, got nil")
+	}
+}
+
+// userID is a named slice element type, standing in for the kind of
+// distinct-named-type slice (e.g. []UserID) In's reflection-based walk is
+// meant to accept just as readily as a plain []int.
+type userID int
+
+func TestIn(t *testing.T) {
+	got := serialize(t, In(testIdent("id"), []int{1, 2, 3}))
+	want := "id IN (1,2,3)"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInNamedSliceType(t *testing.T) {
+	got := serialize(t, In(testIdent("id"), []userID{4, 5}))
+	want := "id IN (4,5)"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInNilSliceIsFalse(t *testing.T) {
+	got := serialize(t, In(testIdent("id"), []int(nil)))
+	want := "FALSE"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInNonSliceIsError(t *testing.T) {
+	w := &standardWriter{}
+	expr := In(testIdent("id"), 5)
+	if err := expr.SerializeSql(nil, w); err == nil {
+		t.Fatal("expected an error for a non-slice value list, got nil")
+	}
+}
+
+func TestInUnsupportedElementTypeIsError(t *testing.T) {
+	w := &standardWriter{}
+	expr := In(testIdent("id"), []bool{true})
+	if err := expr.SerializeSql(nil, w); err == nil {
+		t.Fatal("expected an error for a slice of an unsupported element type, got nil")
+	}
+}
+
+func TestBetween(t *testing.T) {
+	age := testIdent("age")
+
+	got := serialize(t, BetweenL(age, 18, 65))
+	want := "age BETWEEN 18 AND 65"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = serialize(t, NotBetweenL(age, 18, 65))
+	want = "age NOT BETWEEN 18 AND 65"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBetweenParenthesizesLowPrecedenceHi(t *testing.T) {
+	x, y, z := EqL(testIdent("x"), 1), EqL(testIdent("y"), 2), EqL(testIdent("z"), 3)
+
+	got := serialize(t, Between(testIdent("age"), x, And(y, z)))
+	want := "age BETWEEN x=1 AND (y=2 AND z=3)"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWindowExpressionNilPartitionByReturnsError(t *testing.T) {
+	expr := Over(RowNumber()).PartitionBy(nil)
+	w := &standardWriter{}
+	if err := expr.SerializeSql(nil, w); err == nil {
+		t.Fatal("expected an error for a nil PARTITION BY expression, got nil")
+	}
+}
+
+func TestWindowExpression(t *testing.T) {
+	expr := Over(RowNumber()).
+		PartitionBy(testIdent("dept")).
+		OrderBy(Desc(testIdent("salary"))).
+		Frame(RowsFrame, UnboundedPrecedingBound(), CurrentRowBound())
+
+	got := serialize(t, expr)
+	want := "ROW_NUMBER() OVER (PARTITION BY dept ORDER BY salary DESC ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW)"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}